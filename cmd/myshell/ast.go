@@ -0,0 +1,33 @@
+package main
+
+// Command is a single program or builtin invocation along with any
+// redirections that apply to it.
+type Command struct {
+	Name      string
+	Args      []string
+	Redirects []Redirect
+}
+
+// Redirect represents one `>`/`>>`/`2>`/`2>>`-style redirection attached to
+// a Command.
+type Redirect struct {
+	Op   string
+	Path string
+}
+
+// Pipeline is one or more Commands connected with `|`, where each stage's
+// stdout feeds the next stage's stdin. Background is set by a trailing `&`
+// and means the shell shouldn't wait for the pipeline to finish.
+type Pipeline struct {
+	Stages     []*Command
+	Background bool
+}
+
+// Sequence is a list of Pipelines joined by `;`, `&&`, or `||`. Ops[i] is
+// the operator that follows Pipelines[i], so it sits between Pipelines[i]
+// and Pipelines[i+1]. Ops usually has one entry fewer than Pipelines; a line
+// ending in an operator (such as a trailing `;` or `&`) gives it as many.
+type Sequence struct {
+	Pipelines []*Pipeline
+	Ops       []string
+}
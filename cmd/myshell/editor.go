@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// lineEditor holds the in-progress input line as a rune slice plus an
+// insertion point, so readInput can support cursor movement and mid-line
+// edits instead of only ever appending to the end.
+type lineEditor struct {
+	buf    []rune
+	cursor int
+}
+
+func (e *lineEditor) String() string {
+	return string(e.buf)
+}
+
+func (e *lineEditor) Reset() {
+	e.buf = nil
+	e.cursor = 0
+}
+
+func (e *lineEditor) SetText(s string) {
+	e.buf = []rune(s)
+	e.cursor = len(e.buf)
+}
+
+func (e *lineEditor) Insert(r rune) {
+	tail := append([]rune{r}, e.buf[e.cursor:]...)
+	e.buf = append(e.buf[:e.cursor], tail...)
+	e.cursor++
+}
+
+func (e *lineEditor) Backspace() bool {
+	if e.cursor == 0 {
+		return false
+	}
+
+	e.buf = append(e.buf[:e.cursor-1], e.buf[e.cursor:]...)
+	e.cursor--
+	return true
+}
+
+func (e *lineEditor) MoveLeft() bool {
+	if e.cursor == 0 {
+		return false
+	}
+
+	e.cursor--
+	return true
+}
+
+func (e *lineEditor) MoveRight() bool {
+	if e.cursor >= len(e.buf) {
+		return false
+	}
+
+	e.cursor++
+	return true
+}
+
+// wordBeforeCursor returns the whitespace-delimited word immediately to the
+// left of the cursor, for tab completion. It is empty when the cursor sits
+// at the start of the line or right after whitespace.
+func (e *lineEditor) wordBeforeCursor() string {
+	if e.cursor == 0 || unicode.IsSpace(e.buf[e.cursor-1]) {
+		return ""
+	}
+
+	fields := strings.Fields(string(e.buf[:e.cursor]))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[len(fields)-1]
+}
+
+// replaceWordBeforeCursor swaps the word directly before the cursor (as
+// returned by wordBeforeCursor) for replacement.
+func (e *lineEditor) replaceWordBeforeCursor(word, replacement string) {
+	start := e.cursor - len([]rune(word))
+	if start < 0 {
+		start = 0
+	}
+
+	rep := []rune(replacement)
+	tail := append(append([]rune{}, rep...), e.buf[e.cursor:]...)
+	e.buf = append(e.buf[:start], tail...)
+	e.cursor = start + len(rep)
+}
+
+// redrawLine rewrites the current prompt line and repositions the cursor to
+// match the editor's insertion point.
+func redrawLine(e *lineEditor) {
+	fmt.Print("\r\x1b[K")
+	fmt.Printf("$ %s", e.String())
+	fmt.Printf("\x1b[%dG", len("$ ")+e.cursor+1)
+}
+
+// handleTabCompletion mirrors the shell's original tab-completion behavior
+// (complete on a single match; with several, extend the word to the first
+// match only when every other match starts with it, otherwise ring the bell
+// and list all matches on a second tab) but against the word before the
+// cursor rather than always the end of the buffer. A shorter prefix shared
+// by the matches is not filled in on its own.
+func handleTabCompletion(e *lineEditor, tabCount *int) {
+	word := e.wordBeforeCursor()
+	matches := getAutoCompletions(word)
+	*tabCount++
+
+	switch {
+	case len(matches) == 0:
+		fmt.Fprint(os.Stdout, "\a")
+	case len(matches) == 1:
+		e.replaceWordBeforeCursor(word, matches[0]+" ")
+		*tabCount = 0
+	default:
+		longestPrefix := getLongestPrefix(matches)
+		if longestPrefix != "" && longestPrefix != word {
+			e.replaceWordBeforeCursor(word, longestPrefix)
+		} else if *tabCount < 2 {
+			fmt.Fprint(os.Stdout, "\a")
+		} else {
+			fmt.Printf("\r\n%s\n\r", strings.Join(matches, "  "))
+			*tabCount = 0
+		}
+	}
+
+	redrawLine(e)
+}
+
+// readEscapeSequence decodes a CSI escape sequence (`\x1b[A`, `[B`, `[C`,
+// `[D`) that follows an ESC byte already consumed from reader, returning
+// the final letter (A/B/C/D) when recognized.
+func readEscapeSequence(reader *bufio.Reader) (string, bool) {
+	b, err := reader.ReadByte()
+	if err != nil || b != '[' {
+		return "", false
+	}
+
+	b, err = reader.ReadByte()
+	if err != nil {
+		return "", false
+	}
+
+	switch b {
+	case 'A', 'B', 'C', 'D':
+		return string(b), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// executeSequence runs each Pipeline in a Sequence in order, honoring the
+// `;`, `&&`, and `||` operators that connect them.
+func executeSequence(seq *Sequence) {
+	success := true
+
+	for i, pipeline := range seq.Pipelines {
+		if i > 0 {
+			switch seq.Ops[i-1] {
+			case "&&":
+				if !success {
+					continue
+				}
+			case "||":
+				if success {
+					continue
+				}
+			}
+		}
+
+		success = executePipeline(pipeline)
+	}
+}
+
+// executePipeline runs a single `|`-connected Pipeline and reports whether
+// its last stage succeeded. A backgrounded Pipeline is dispatched without
+// waiting and always reports success to its caller.
+func executePipeline(p *Pipeline) bool {
+	if p.Background {
+		runBackground(p)
+		return true
+	}
+
+	if len(p.Stages) == 1 {
+		return executeSingle(p.Stages[0])
+	}
+
+	return executeMultiStage(p)
+}
+
+// runBackground starts a Pipeline without waiting for it. A single external
+// command gets full job-table tracking (so `jobs`/`fg`/`bg` see it);
+// anything else (a builtin, or a multi-stage pipeline) just runs on its own
+// goroutine.
+func runBackground(p *Pipeline) {
+	if len(p.Stages) == 1 {
+		stage := p.Stages[0]
+		if _, isBuiltin := builtinCmd[stage.Name]; !isBuiltin && isInPath(stage.Name) {
+			stdout, stderr, cleanup, err := resolveStageOutputs(stage, os.Stdout)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return
+			}
+			defer cleanup()
+
+			runBackgroundExternal(stage, stdout, stderr)
+			return
+		}
+	}
+
+	foreground := &Pipeline{Stages: p.Stages}
+	go executePipeline(foreground)
+}
+
+// executeMultiStage wires each stage's stdout to the next stage's stdin via
+// io.Pipe and runs all stages concurrently, the way a real shell runs a
+// pipeline.
+func executeMultiStage(p *Pipeline) bool {
+	n := len(p.Stages)
+	readers := make([]*io.PipeReader, n-1)
+	writers := make([]*io.PipeWriter, n-1)
+	for i := range writers {
+		readers[i], writers[i] = io.Pipe()
+	}
+
+	results := make([]bool, n)
+	var wg sync.WaitGroup
+
+	for i, stage := range p.Stages {
+		stage := stage
+		i := i
+
+		var stdin io.Reader = os.Stdin
+		if i > 0 {
+			stdin = readers[i-1]
+		}
+
+		var stdout io.Writer = os.Stdout
+		var writer *io.PipeWriter
+		if i < n-1 {
+			writer = writers[i]
+			stdout = writer
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runStage(stage, stdin, stdout)
+			if writer != nil {
+				writer.Close()
+			}
+			if i > 0 {
+				readers[i-1].Close()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return results[n-1]
+}
+
+// runStage executes a single pipeline stage, whether a builtin or an
+// external program, streaming its output to stdout unless the stage itself
+// redirects to a file.
+func runStage(cmd *Command, stdin io.Reader, defaultStdout io.Writer) bool {
+	stdout, stderr, cleanup, err := resolveStageOutputs(cmd, defaultStdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	defer cleanup()
+
+	cmdFn, isBuiltin := builtinCmd[cmd.Name]
+	if isBuiltin {
+		if err := cmdFn(cmd.Args, stdout); err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			return false
+		}
+
+		return true
+	}
+
+	if !isInPath(cmd.Name) {
+		fmt.Fprintf(stderr, "%s: command not found\n", cmd.Name)
+		return false
+	}
+
+	execCmd := exec.Command(cmd.Name, cmd.Args...)
+	execCmd.Stdin = stdin
+	execCmd.Stdout = stdout
+	execCmd.Stderr = stderr
+
+	return execCmd.Run() == nil
+}
+
+// resolveStageOutputs opens any files a stage's redirects point at and
+// returns the stdout/stderr writers the stage should use, along with a
+// cleanup func that closes whatever files were opened.
+func resolveStageOutputs(cmd *Command, defaultStdout io.Writer) (io.Writer, io.Writer, func(), error) {
+	stdout := defaultStdout
+	var stderr io.Writer = os.Stderr
+	var opened []io.Closer
+
+	for _, r := range cmd.Redirects {
+		var file *os.File
+		var err error
+
+		switch r.Op {
+		case ">", "1>":
+			file, err = os.Create(r.Path)
+		case ">>", "1>>":
+			file, err = os.OpenFile(r.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		case "2>":
+			file, err = os.Create(r.Path)
+		case "2>>":
+			file, err = os.OpenFile(r.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		}
+
+		if err != nil {
+			for _, c := range opened {
+				c.Close()
+			}
+			return nil, nil, nil, err
+		}
+
+		if file == nil {
+			continue
+		}
+
+		opened = append(opened, file)
+		if r.Op == "2>" || r.Op == "2>>" {
+			stderr = file
+		} else {
+			stdout = file
+		}
+	}
+
+	cleanup := func() {
+		for _, c := range opened {
+			c.Close()
+		}
+	}
+
+	return stdout, stderr, cleanup, nil
+}
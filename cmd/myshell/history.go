@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	HISTFILE_ENV       = "HISTFILE"
+	defaultHistoryFile = ".shell_go_history"
+	maxHistorySize     = 1000
+)
+
+// commandHistory is the in-memory ring of accepted input lines, most recent
+// last. It's loaded from $HISTFILE at startup and appended to as the user
+// runs commands.
+var commandHistory []string
+
+func init() {
+	registerCmd("history", historyCmd)
+}
+
+// historyFilePath returns $HISTFILE, or ~/.shell_go_history when it's unset.
+func historyFilePath() string {
+	if p := os.Getenv(HISTFILE_ENV); p != "" {
+		return p
+	}
+
+	home := os.Getenv(HOME_ENV)
+	if home == "" {
+		return ""
+	}
+
+	return path.Join(home, defaultHistoryFile)
+}
+
+// loadHistory populates commandHistory from the history file, if any.
+func loadHistory() {
+	p := historyFilePath()
+	if p == "" {
+		return
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		appendHistory(scanner.Text(), false)
+	}
+}
+
+// appendHistory records a line in commandHistory (deduping immediate
+// repeats) and, when persist is true, appends it to the history file.
+func appendHistory(line string, persist bool) {
+	if line == "" {
+		return
+	}
+
+	if n := len(commandHistory); n > 0 && commandHistory[n-1] == line {
+		return
+	}
+
+	commandHistory = append(commandHistory, line)
+	if len(commandHistory) > maxHistorySize {
+		commandHistory = commandHistory[len(commandHistory)-maxHistorySize:]
+	}
+
+	if !persist {
+		return
+	}
+
+	p := historyFilePath()
+	if p == "" {
+		return
+	}
+
+	file, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	fmt.Fprintln(file, line)
+}
+
+// historyCmd lists the recorded history, or clears it with `history -c`.
+func historyCmd(args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "-c" {
+		commandHistory = nil
+		return nil
+	}
+
+	for i, entry := range commandHistory {
+		fmt.Fprintf(out, "%5d  %s\n", i+1, entry)
+	}
+
+	return nil
+}
+
+// navigateHistory moves idx by delta (-1 for older, +1 for newer), clamped
+// to [0, len(commandHistory)], and loads the resulting entry into e. An
+// index equal to len(commandHistory) means "not browsing history", which
+// clears e instead.
+func navigateHistory(e *lineEditor, idx, delta int) int {
+	newIdx := idx + delta
+	if newIdx < 0 {
+		newIdx = 0
+	}
+	if newIdx > len(commandHistory) {
+		newIdx = len(commandHistory)
+	}
+
+	if newIdx == len(commandHistory) {
+		e.SetText("")
+	} else {
+		e.SetText(commandHistory[newIdx])
+	}
+
+	return newIdx
+}
+
+// reverseSearch implements Ctrl-R incremental reverse search: it reads
+// further bytes from reader, growing or shrinking a query and redrawing a
+// `(reverse-i-search)` prompt, until Enter accepts the current match or
+// Escape/Ctrl-C cancels.
+func reverseSearch(reader *bufio.Reader) (string, bool) {
+	var query strings.Builder
+	matchIdx := len(commandHistory) - 1
+	currentMatch := ""
+
+	search := func(from int) (int, string) {
+		q := query.String()
+		if q == "" {
+			return -1, ""
+		}
+
+		for i := from; i >= 0; i-- {
+			if strings.Contains(commandHistory[i], q) {
+				return i, commandHistory[i]
+			}
+		}
+
+		return -1, ""
+	}
+
+	redraw := func() {
+		fmt.Print("\r\x1b[K")
+		fmt.Printf("(reverse-i-search)`%s': %s", query.String(), currentMatch)
+	}
+
+	redraw()
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", false
+		}
+
+		switch b {
+		case 0x12: // Ctrl-R again: jump to the next older match
+			if matchIdx > 0 {
+				if idx, match := search(matchIdx - 1); idx >= 0 {
+					matchIdx, currentMatch = idx, match
+				}
+			}
+		case '\r', '\n':
+			fmt.Fprint(os.Stdout, "\r\n")
+			return currentMatch, currentMatch != ""
+		case '\x1b', 0x03: // Escape or Ctrl-C
+			return "", false
+		case '\x7F':
+			if s := query.String(); s != "" {
+				query.Reset()
+				query.WriteString(s[:len(s)-1])
+			}
+			matchIdx = len(commandHistory) - 1
+			matchIdx, currentMatch = search(matchIdx)
+		default:
+			query.WriteByte(b)
+			matchIdx = len(commandHistory) - 1
+			matchIdx, currentMatch = search(matchIdx)
+		}
+
+		redraw()
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// JobStatus is the run state of a backgrounded or stopped job.
+type JobStatus int
+
+const (
+	JobRunning JobStatus = iota
+	JobStopped
+)
+
+func (s JobStatus) String() string {
+	if s == JobStopped {
+		return "Stopped"
+	}
+
+	return "Running"
+}
+
+// Job tracks one process group the shell has started, so `jobs`/`fg`/`bg`
+// and the SIGINT/SIGTSTP handlers can find it by job ID. done and stopped
+// are closed (never sent on) so that every interested goroutine - the
+// foreground waiter, a background completion watcher, or both across a
+// `fg`/`bg` promotion - observes the same event instead of racing to
+// receive a single buffered value.
+type Job struct {
+	ID      int
+	Pgid    int
+	Command string
+	Status  JobStatus
+	Cmd     *exec.Cmd
+	Err     error
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+var (
+	jobsMu        sync.Mutex
+	jobTable      = map[int]*Job{}
+	nextJobID     = 1
+	foregroundJob *Job
+	shellPgid     int
+)
+
+// initJobControl puts the shell in its own process group's good graces: it
+// ignores the tty-driver signals that would otherwise stop a background
+// shell, then installs handlers for SIGINT/SIGTSTP/SIGCHLD so that neither
+// one kills the shell outright.
+func initJobControl() {
+	shellPgid = syscall.Getpgrp()
+	signal.Ignore(syscall.SIGTTOU, syscall.SIGTTIN)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTSTP, syscall.SIGCHLD)
+	go handleJobSignals(sigCh)
+}
+
+func handleJobSignals(sigCh <-chan os.Signal) {
+	for sig := range sigCh {
+		switch sig {
+		case syscall.SIGINT:
+			if job := currentForegroundJob(); job != nil {
+				syscall.Kill(-job.Pgid, syscall.SIGINT)
+			}
+		case syscall.SIGTSTP:
+			stopForegroundJob()
+		case syscall.SIGCHLD:
+			// Each job reaps its own process via its `done` channel
+			// goroutine; this handler just keeps SIGCHLD from falling
+			// through to the default disposition.
+		}
+	}
+}
+
+// stopForegroundJob forwards SIGTSTP to the foreground job's process group.
+// It does not itself wait for the stop to land: once executeProgram hands
+// the job the controlling terminal, a keyboard-driven SIGTSTP is delivered
+// by the tty driver straight to the job's process group, not the shell's, so
+// this handler won't even run for that case. The job's reaper goroutine
+// (started in addJob) is what actually detects the stop via a WUNTRACED
+// wait4 and records it; this just covers SIGTSTP arriving some other way
+// (e.g. `kill -TSTP` aimed at the shell itself).
+func stopForegroundJob() {
+	job := currentForegroundJob()
+	if job == nil {
+		return
+	}
+
+	syscall.Kill(-job.Pgid, syscall.SIGTSTP)
+}
+
+func currentForegroundJob() *Job {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	return foregroundJob
+}
+
+func setForegroundJob(job *Job) {
+	jobsMu.Lock()
+	foregroundJob = job
+	jobsMu.Unlock()
+}
+
+func clearForegroundJob() {
+	jobsMu.Lock()
+	foregroundJob = nil
+	jobsMu.Unlock()
+}
+
+// giveTerminalTo makes pgid the terminal's controlling process group, the
+// way a shell hands the tty to a foreground job (or takes it back).
+func giveTerminalTo(pgid int) {
+	unix.IoctlSetPointerInt(int(os.Stdin.Fd()), unix.TIOCSPGRP, pgid)
+}
+
+func commandLine(name string, args []string) string {
+	return strings.TrimSpace(name + " " + strings.Join(args, " "))
+}
+
+// addJob registers a started *exec.Cmd as a new job in its own process
+// group (cmd.Process.Pid doubles as the pgid, since SysProcAttr.Setpgid was
+// set with Pgid 0).
+func addJob(cmd *exec.Cmd, command string) *Job {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	job := &Job{
+		ID:      nextJobID,
+		Pgid:    cmd.Process.Pid,
+		Command: command,
+		Status:  JobRunning,
+		Cmd:     cmd,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	jobTable[job.ID] = job
+	nextJobID++
+
+	go reapJob(job)
+
+	return job
+}
+
+// reapJob waits on a job's process directly via wait4(WUNTRACED) instead of
+// cmd.Wait(), because cmd.Wait() only reports on exit. Once the job owns the
+// controlling terminal, a keyboard Ctrl-Z is delivered by the tty driver to
+// the job's process group, not the shell's, so the shell's own SIGTSTP
+// handler never fires for it — wait4 on the child itself is the only place
+// that reliably observes the stop. It loops so that a resumed (SIGCONT'd)
+// job keeps being watched for subsequent stops, until it finally exits.
+func reapJob(job *Job) {
+	for {
+		var status syscall.WaitStatus
+		_, err := syscall.Wait4(job.Pgid, &status, syscall.WUNTRACED, nil)
+		if err != nil {
+			jobsMu.Lock()
+			job.Err = err
+			jobsMu.Unlock()
+			close(job.done)
+			return
+		}
+
+		if status.Stopped() {
+			jobsMu.Lock()
+			job.Status = JobStopped
+			stopped := job.stopped
+			jobsMu.Unlock()
+			close(stopped)
+			continue
+		}
+
+		if status.Exited() {
+			var exitErr error
+			if code := status.ExitStatus(); code != 0 {
+				exitErr = fmt.Errorf("exit status %d", code)
+			}
+			jobsMu.Lock()
+			job.Err = exitErr
+			jobsMu.Unlock()
+			close(job.done)
+			return
+		}
+
+		if status.Signaled() {
+			jobsMu.Lock()
+			job.Err = fmt.Errorf("signal: %s", status.Signal())
+			jobsMu.Unlock()
+			close(job.done)
+			return
+		}
+	}
+}
+
+func removeJob(id int) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	delete(jobTable, id)
+}
+
+// waitOnForeground blocks until a foreground job either exits or is
+// stopped (via Ctrl-Z/SIGTSTP), restoring the terminal to the shell either
+// way, and reports whether it's still alive (stopped) afterwards.
+func waitOnForeground(job *Job) (err error, stopped bool) {
+	select {
+	case <-job.done:
+		jobsMu.Lock()
+		err = job.Err
+		jobsMu.Unlock()
+		giveTerminalTo(shellPgid)
+		clearForegroundJob()
+		removeJob(job.ID)
+		return err, false
+	case <-job.stopped:
+		giveTerminalTo(shellPgid)
+		clearForegroundJob()
+		fmt.Fprintf(os.Stdout, "\n[%d]+  Stopped\t%s\n", job.ID, job.Command)
+		return nil, true
+	}
+}
+
+// runBackgroundExternal starts an external command detached in its own
+// process group without waiting on it, the way a trailing `&` does, and
+// prints its job number the way a shell does.
+func runBackgroundExternal(cmd *Command, stdout, stderr io.Writer) {
+	execCmd := exec.Command(cmd.Name, cmd.Args...)
+	execCmd.Stdout = stdout
+	execCmd.Stderr = stderr
+	execCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := execCmd.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	job := addJob(execCmd, commandLine(cmd.Name, cmd.Args))
+	fmt.Fprintf(os.Stdout, "[%d] %d\n", job.ID, execCmd.Process.Pid)
+
+	go watchBackgroundCompletion(job)
+}
+
+// watchBackgroundCompletion waits for a backgrounded job to finish and
+// prints the `jobs`-style completion line, the way a shell reports a
+// background job wrapping up on its own. If the job gets `fg`'d before it
+// finishes, waitOnForeground becomes the one reporting (and reaping) its
+// completion instead, so this bows out rather than racing it for the same
+// job.done close.
+func watchBackgroundCompletion(job *Job) {
+	<-job.done
+
+	jobsMu.Lock()
+	if foregroundJob == job {
+		jobsMu.Unlock()
+		return
+	}
+
+	status := "Done"
+	if job.Err != nil {
+		status = job.Err.Error()
+	}
+	alreadyGone := jobTable[job.ID] == nil
+	jobsMu.Unlock()
+
+	if alreadyGone {
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, "\n[%d]+  %s\t%s\n", job.ID, status, job.Command)
+	removeJob(job.ID)
+}
+
+func jobsCmd(args []string, out io.Writer) error {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	ids := make([]int, 0, len(jobTable))
+	for id := range jobTable {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		job := jobTable[id]
+		fmt.Fprintf(out, "[%d]  %-8s %s\n", job.ID, job.Status, job.Command)
+	}
+
+	return nil
+}
+
+func fgCmd(args []string, out io.Writer) error {
+	job, err := resolveJobArg(args)
+	if err != nil {
+		return err
+	}
+
+	return resumeJob(job, true)
+}
+
+func bgCmd(args []string, out io.Writer) error {
+	job, err := resolveJobArg(args)
+	if err != nil {
+		return err
+	}
+
+	return resumeJob(job, false)
+}
+
+// resolveJobArg finds the job named by a `%N`/`N` argument, or the most
+// recently started job when no argument is given.
+func resolveJobArg(args []string) (*Job, error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	if len(args) == 0 {
+		var latest *Job
+		for _, job := range jobTable {
+			if latest == nil || job.ID > latest.ID {
+				latest = job
+			}
+		}
+
+		if latest == nil {
+			return nil, errors.New("no current jobs")
+		}
+
+		return latest, nil
+	}
+
+	idStr := strings.TrimPrefix(args[0], "%")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: no such job", args[0])
+	}
+
+	job, ok := jobTable[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: no such job", args[0])
+	}
+
+	return job, nil
+}
+
+// resumeJob sends SIGCONT to a stopped job's process group, then either
+// waits on it in the foreground or leaves it running in the background.
+func resumeJob(job *Job, foreground bool) error {
+	jobsMu.Lock()
+	job.Status = JobRunning
+	job.stopped = make(chan struct{})
+	jobsMu.Unlock()
+
+	syscall.Kill(-job.Pgid, syscall.SIGCONT)
+
+	if !foreground {
+		fmt.Fprintf(os.Stdout, "[%d]+  %s &\n", job.ID, job.Command)
+		go watchBackgroundCompletion(job)
+		return nil
+	}
+
+	setForegroundJob(job)
+	giveTerminalTo(job.Pgid)
+
+	err, _ := waitOnForeground(job)
+	return err
+}
@@ -2,82 +2,81 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/user"
 	"path"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"golang.org/x/term"
 )
 
 const (
-	PATH_ENV = "PATH"
-	PWD_ENV  = "PWD"
-	HOME_ENV = "HOME"
+	PATH_ENV   = "PATH"
+	PWD_ENV    = "PWD"
+	OLDPWD_ENV = "OLDPWD"
+	HOME_ENV   = "HOME"
 )
 
-type CmdFn = func([]string) (string, error)
+type CmdFn = func(args []string, out io.Writer) error
 
 var builtinCmd = map[string]CmdFn{}
 
 func main() {
 	initCommands()
+	loadHistory()
+	initJobControl()
 	for {
 		fmt.Fprint(os.Stdout, "$ ")
 		input := readInput(os.Stdin)
 		input = strings.TrimSpace(input)
-		args := parseUserInput(input)
-		if len(args) == 0 {
+		tokens := parseUserInput(input)
+		if len(tokens) == 0 {
 			fmt.Println("Please provide a command")
 			continue
 		}
 
-		command := args[0]
-		args = args[1:]
-		redirectIndex := slices.IndexFunc(args, func(n string) bool {
-			return isRedirectOperator(n)
-		})
-		redirectArgs := []string{}
-		if redirectIndex >= 0 {
-			redirectArgs = args[redirectIndex:]
-			args = args[:redirectIndex]
+		seq, err := parse(tokens)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
 		}
 
-		cmdFn, exist := builtinCmd[command]
-		if exist {
-			stdOutput, err := cmdFn(args)
-			var errorMsg string
-			if err != nil {
-				errorMsg = err.Error()
-				fmt.Fprint(os.Stderr, errorMsg+"\n")
-			}
+		executeSequence(seq)
+	}
+}
 
-			if redirectIndex >= 0 {
-				redirect(stdOutput, errorMsg, redirectArgs)
-			} else {
-				fmt.Fprint(os.Stdout, stdOutput)
-			}
-		} else {
-			output, errMsg := executeProgram(command, args)
-			if errMsg != "" {
-				if redirectIndex >= 0 && redirectArgs[0] != "2>" && redirectArgs[0] != "2>>" {
-					fmt.Fprint(os.Stderr, errMsg)
-				}
-			}
+// executeSingle runs a Command that isn't part of a multi-stage pipeline,
+// as the foreground job: output streams straight to stdout/stderr (or a
+// redirect target) instead of being buffered up first, and it gets job
+// control (its own process group, the controlling terminal) the same way
+// executeProgram's external-command path does.
+func executeSingle(cmd *Command) bool {
+	stdout, stderr, cleanup, err := resolveStageOutputs(cmd, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	defer cleanup()
 
-			if redirectIndex >= 0 {
-				redirect(output, errMsg, redirectArgs)
-			} else {
-				fmt.Fprint(os.Stdout, output)
-			}
+	cmdFn, exist := builtinCmd[cmd.Name]
+	if exist {
+		if err := cmdFn(cmd.Args, stdout); err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			return false
 		}
+
+		return true
 	}
+
+	return executeProgram(cmd.Name, cmd.Args, stdout, stderr)
 }
 
 func initCommands() {
@@ -86,12 +85,19 @@ func initCommands() {
 	registerCmd("type", typeCmd)
 	registerCmd("pwd", pwdCmd)
 	registerCmd("cd", cdCmd)
+	registerCmd("jobs", jobsCmd)
+	registerCmd("fg", fgCmd)
+	registerCmd("bg", bgCmd)
 }
 
 func registerCmd(key string, cmdFn CmdFn) {
 	builtinCmd[key] = cmdFn
 }
 
+// readInput reads one line from rd in the terminal's raw mode, supporting
+// backspace, tab completion, history navigation via the up/down arrow
+// keys, cursor movement via left/right, and Ctrl-R incremental reverse
+// history search. Accepted non-blank lines are recorded in commandHistory.
 func readInput(rd io.Reader) string {
 	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
 	if err != nil {
@@ -101,7 +107,8 @@ func readInput(rd io.Reader) string {
 	defer term.Restore(int(os.Stdin.Fd()), oldState)
 
 	reader := bufio.NewReader(rd)
-	var buffer bytes.Buffer
+	editor := &lineEditor{}
+	historyIndex := len(commandHistory)
 	var input string
 	var tabCount int
 
@@ -112,77 +119,66 @@ loop:
 			break
 		}
 
-		switch rune(b) {
+		switch b {
 		// backspace key
 		case '\x7F':
-			if buffer.Len() > 0 {
-				buffer.Truncate(buffer.Len() - 1)
-				fmt.Fprint(os.Stdout, "\b \b")
+			if editor.Backspace() {
+				redrawLine(editor)
 			}
+			continue
 		// enter key
 		case '\n', '\r':
-			input = buffer.String()
-			buffer.Reset()
+			input = editor.String()
 			fmt.Fprintf(os.Stdout, "\r\n")
 			break loop
 		// tab key
 		case '\t':
-			str := strings.Fields(buffer.String())
-			substring := str[len(str)-1]
-			matches := getAutoCompletions(substring)
-			tabCount++
-
-			if len(matches) == 0 {
-				fmt.Fprint(os.Stdout, "\a")
-			} else if len(matches) == 1 {
-				buffer.Truncate(buffer.Len() - len(substring))
-				buffer.WriteString(matches[0] + " ")
-				tabCount = 0
-			} else {
-				longestPrefix := getLongestPrefix(matches)
-				if longestPrefix != "" {
-					buffer.Reset()
-					buffer.WriteString(longestPrefix)
-				} else if tabCount < 2 {
-					fmt.Print("\a")
-				} else if tabCount >= 2 {
-					fmt.Printf("\r\n%s\n\r", strings.Join(matches, "  "))
-					tabCount = 0
-				}
-
-				redrawLine(&buffer)
+			handleTabCompletion(editor, &tabCount)
+			continue
+		// Ctrl-R: reverse-incremental history search
+		case 0x12:
+			if match, ok := reverseSearch(reader); ok {
+				input = match
+				break loop
+			}
+			redrawLine(editor)
+			continue
+		// ESC: arrow keys arrive as CSI sequences (`\x1b[A` etc.)
+		case 0x1b:
+			seq, ok := readEscapeSequence(reader)
+			if !ok {
 				continue
 			}
+
+			switch seq {
+			case "A":
+				historyIndex = navigateHistory(editor, historyIndex, -1)
+			case "B":
+				historyIndex = navigateHistory(editor, historyIndex, 1)
+			case "C":
+				editor.MoveRight()
+			case "D":
+				editor.MoveLeft()
+			}
+
+			redrawLine(editor)
+			continue
 		default:
-			buffer.WriteByte(b)
+			tabCount = 0
+			editor.Insert(rune(b))
 		}
 
 		// rewrites the buffer each time we type a char
-		redrawLine(&buffer)
+		redrawLine(editor)
 	}
 
-	return input
-}
+	if trimmed := strings.TrimSpace(input); trimmed != "" {
+		appendHistory(trimmed, true)
+	}
 
-func redrawLine(buffer *bytes.Buffer) {
-	fmt.Print("\r\x1b[K")
-	fmt.Printf("$ %s", buffer.String())
-	fmt.Print("\x1b[?25h")
+	return input
 }
 
-// func getLongestPrefixLength(prefix, match string) int {
-// 	res := 0
-// 	for i, char := range prefix {
-// 		if rune(match[i]) != char {
-// 			break
-// 		}
-
-// 		res++
-// 	}
-
-// 	return res
-// }
-
 func getLongestPrefix(matches []string) string {
 	if len(matches) <= 0 {
 		return ""
@@ -231,200 +227,236 @@ func getAutoCompletions(prefix string) []string {
 	return matches
 }
 
-func redirect(output, errorOutput string, redirectedArgs []string) {
-	if len(redirectedArgs) < 2 {
-		fmt.Fprint(os.Stdout, "please provide valid arguments for redirection")
-		return
+func isRedirectOperator(operator string) bool {
+	operators := []string{"1>", ">", "2>", ">>", "1>>", "2>>"}
+	return slices.Index(operators, operator) >= 0
+}
+
+// executeProgram runs an external program as the foreground job, streaming
+// its output straight to stdout/stderr instead of buffering it up first. It
+// gets its own process group and the controlling terminal for the duration
+// of the run, so Ctrl-C/Ctrl-Z reach it (and only it) instead of the shell.
+func executeProgram(command string, args []string, stdout, stderr io.Writer) bool {
+	if !isInPath(command) {
+		fmt.Fprintf(stderr, "%s: command not found\n", command)
+		return false
 	}
 
-	redirectOperator := redirectedArgs[0]
-	filePath := redirectedArgs[1]
-	switch redirectOperator {
-	case "2>":
-		if output != "" {
-			fmt.Fprint(os.Stdout, output)
-		}
+	cmd := exec.Command(command, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
-		err := os.WriteFile(filePath, []byte(errorOutput), 0644)
-		if err != nil {
-			fmt.Fprint(os.Stdout, err.Error())
-		}
-	case "2>>":
-		if output != "" {
-			fmt.Fprint(os.Stdout, output)
-		}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return false
+	}
 
-		file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			fmt.Fprint(os.Stdout, err.Error())
-			return
-		}
+	job := addJob(cmd, commandLine(command, args))
+	setForegroundJob(job)
+	giveTerminalTo(job.Pgid)
 
-		defer file.Close()
-		file.WriteString(errorOutput)
-	case ">>", "1>>":
-		file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			fmt.Fprint(os.Stdout, err.Error())
-			return
-		}
+	err, stopped := waitOnForeground(job)
+	if stopped {
+		return true
+	}
 
-		defer file.Close()
-		file.WriteString(output)
-	default:
-		err := os.WriteFile(filePath, []byte(output), 0644)
-		if err != nil {
-			fmt.Fprint(os.Stdout, err.Error())
+	return err == nil
+}
+
+func isInPath(command string) bool {
+	paths := strings.Split(os.Getenv(PATH_ENV), ":")
+	for _, p := range paths {
+		filePath := path.Join(p, command)
+		_, err := os.Stat(filePath)
+		if !errors.Is(err, os.ErrNotExist) {
+			return true
 		}
 	}
-}
 
-func isRedirectOperator(operator string) bool {
-	operators := []string{"1>", ">", "2>", ">>", "1>>", "2>>"}
-	return slices.Index(operators, operator) >= 0
+	return false
 }
 
-func parseUserInput(input string) []string {
-	args := []string{}
-	inSingleQuote := false
-	inDoubleQuote := false
-	escaped := false
-	var current strings.Builder
-	for _, char := range input {
-		switch char {
-		case '\\':
-			if escaped || inSingleQuote {
-				current.WriteRune(char)
-				escaped = false
-			} else {
-				escaped = true
-			}
-		case '"':
-			if escaped || inSingleQuote {
-				current.WriteRune(char)
-			} else {
-				inDoubleQuote = !inDoubleQuote
-			}
+// cdCmd changes the process's working directory via os.Chdir, keeping
+// $PWD/$OLDPWD in sync the way a login shell does. It supports `cd -`
+// (swap to $OLDPWD), bare `cd` (go to $HOME), and the POSIX `-L`/`-P`
+// flags to pick logical (symlinks preserved) vs. physical path resolution.
+func cdCmd(args []string, out io.Writer) error {
+	physical := false
+	var positional []string
+
+	for _, a := range args {
+		switch a {
+		case "-L":
+			physical = false
+		case "-P":
+			physical = true
+		default:
+			positional = append(positional, a)
+		}
+	}
 
-			escaped = false
-		case '\'':
-			if inDoubleQuote && escaped {
-				current.WriteRune('\\')
-			}
+	if len(positional) > 1 {
+		return errors.New("cd: too many arguments")
+	}
 
-			if escaped || inDoubleQuote {
-				current.WriteRune(char)
-			} else {
-				inSingleQuote = !inSingleQuote
-			}
+	var target string
+	printNewDir := false
 
-			escaped = false
-		case ' ':
-			if inDoubleQuote && escaped {
-				current.WriteRune('\\')
-			}
+	switch {
+	case len(positional) == 0:
+		home := os.Getenv(HOME_ENV)
+		if home == "" {
+			return errors.New("cd: HOME not set")
+		}
+		target = home
+	case positional[0] == "-":
+		oldpwd := os.Getenv(OLDPWD_ENV)
+		if oldpwd == "" {
+			return errors.New("cd: OLDPWD not set")
+		}
+		target = oldpwd
+		printNewDir = true
+	case strings.HasPrefix(positional[0], "~"):
+		expanded, err := expandTilde(positional[0])
+		if err != nil {
+			return err
+		}
+		target = expanded
+	default:
+		target = positional[0]
+	}
 
-			if escaped || inSingleQuote || inDoubleQuote {
-				current.WriteRune(char)
-			} else if current.Len() > 0 {
-				args = append(args, current.String())
-				current.Reset()
+	if !path.IsAbs(target) {
+		base := os.Getenv(PWD_ENV)
+		if physical || base == "" {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
 			}
-
-			escaped = false
-		default:
-			if escaped && inDoubleQuote {
-				current.WriteRune('\\')
+			base = cwd
+		}
+		if physical {
+			if resolved, err := filepath.EvalSymlinks(base); err == nil {
+				base = resolved
 			}
+		}
+		target = path.Join(base, target)
+	}
 
-			current.WriteRune(char)
-			escaped = false
+	if physical {
+		resolved, err := filepath.EvalSymlinks(target)
+		if err != nil {
+			return fmt.Errorf("cd: %s: No such file or directory", target)
 		}
+		target = resolved
 	}
 
-	if current.Len() > 0 {
-		args = append(args, current.String())
+	if _, err := os.Stat(target); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cd: %s: No such file or directory", target)
 	}
 
-	return args
-}
+	oldpwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
 
-func executeProgram(command string, args []string) (string, string) {
-	if isInPath(command) {
-		cmd := exec.Command(command, args...)
-		output, err := cmd.Output()
-		var errMsg string
-		if err != nil {
-			if stderr, ok := err.(*exec.ExitError); ok {
-				errMsg = string(stderr.Stderr)
-			} else {
-				errMsg = err.Error()
-			}
-		}
+	if err := os.Chdir(target); err != nil {
+		return fmt.Errorf("cd: %s: %s", target, err)
+	}
 
-		return string(output), errMsg
+	newpwd := path.Clean(target)
+	os.Setenv(OLDPWD_ENV, oldpwd)
+	os.Setenv(PWD_ENV, newpwd)
+
+	if printNewDir {
+		fmt.Fprintln(out, newpwd)
 	}
 
-	return fmt.Sprintf("%s: command not found\n", command), ""
+	return nil
 }
 
-func isInPath(command string) bool {
-	paths := strings.Split(os.Getenv(PATH_ENV), ":")
-	for _, p := range paths {
-		filePath := path.Join(p, command)
-		_, err := os.Stat(filePath)
-		if !errors.Is(err, os.ErrNotExist) {
-			return true
+// expandTilde resolves a leading `~` (the caller's home directory) or
+// `~user` (that user's home directory, via os/user.Lookup) at the start of
+// p. A `~` anywhere else in p is left untouched.
+func expandTilde(p string) (string, error) {
+	rest := strings.TrimPrefix(p, "~")
+	username := rest
+	remainder := ""
+	if idx := strings.IndexByte(rest, '/'); idx >= 0 {
+		username = rest[:idx]
+		remainder = rest[idx:]
+	}
+
+	if username == "" {
+		home := os.Getenv(HOME_ENV)
+		if home == "" {
+			return "", errors.New("cd: HOME not set")
 		}
+		return home + remainder, nil
 	}
 
-	return false
+	u, err := user.Lookup(username)
+	if err != nil {
+		return "", fmt.Errorf("cd: %s: no such user", username)
+	}
+
+	return u.HomeDir + remainder, nil
 }
 
-func cdCmd(args []string) (string, error) {
-	if len(args) == 0 {
-		return "", errors.New("please provide an argument for the cd command")
+// pwdCmd reports the current working directory, honoring `-L` (the
+// logical, symlink-preserving $PWD tracked by cdCmd, the default) and `-P`
+// (the physical path resolved via os.Getwd and filepath.EvalSymlinks).
+func pwdCmd(args []string, out io.Writer) error {
+	physical := false
+	for _, a := range args {
+		switch a {
+		case "-L":
+			physical = false
+		case "-P":
+			physical = true
+		default:
+			return fmt.Errorf("pwd: invalid option %s", a)
+		}
 	}
 
-	dirPath := args[0]
-	if !path.IsAbs(dirPath) {
-		if strings.Contains(dirPath, "~") {
-			dirPath = strings.ReplaceAll(dirPath, "~", os.Getenv(HOME_ENV))
-		} else {
-			dirPath = path.Join(os.Getenv(PWD_ENV), dirPath)
+	if !physical {
+		if pwd := os.Getenv(PWD_ENV); pwd != "" {
+			fmt.Fprintln(out, pwd)
+			return nil
 		}
 	}
 
-	if _, err := os.Stat(dirPath); errors.Is(err, os.ErrNotExist) {
-		return "", fmt.Errorf("cd: %s: No such file or directory", dirPath)
+	cwd, err := os.Getwd()
+	if err != nil {
+		return errors.New("cannot get current working directory")
 	}
 
-	os.Setenv(PWD_ENV, dirPath)
-	return "", nil
-}
-
-func pwdCmd(args []string) (string, error) {
-	if len(args) > 0 {
-		return "", errors.New("pwd: too many arguments")
+	if !physical {
+		fmt.Fprintln(out, cwd)
+		return nil
 	}
 
-	res := os.Getenv(PWD_ENV)
-	if res == "" {
-		return "", errors.New("cannot get current working directory")
+	resolved, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return err
 	}
 
-	return res + "\n", nil
+	fmt.Fprintln(out, resolved)
+	return nil
 }
 
-func typeCmd(args []string) (string, error) {
+func typeCmd(args []string, out io.Writer) error {
 	if len(args) == 0 {
-		return "", errors.New("please provide an argument for the type command")
+		return errors.New("please provide an argument for the type command")
 	}
 
 	command := args[0]
 	_, exists := builtinCmd[command]
 	if exists {
-		return fmt.Sprintf("%s is a shell builtin\n", command), nil
+		fmt.Fprintf(out, "%s is a shell builtin\n", command)
+		return nil
 	}
 
 	paths := strings.Split(os.Getenv(PATH_ENV), ":")
@@ -438,31 +470,33 @@ func typeCmd(args []string) (string, error) {
 		}
 	}
 
-	return output + "\n", nil
+	fmt.Fprintln(out, output)
+	return nil
 }
 
-func echoCmd(args []string) (string, error) {
+func echoCmd(args []string, out io.Writer) error {
 	if len(args) == 0 {
-		return "", errors.New("please provide an argument for the echo command")
+		return errors.New("please provide an argument for the echo command")
 	}
 
-	return strings.Join(args, " ") + "\n", nil
+	fmt.Fprintln(out, strings.Join(args, " "))
+	return nil
 }
 
-func exitCmd(args []string) (string, error) {
+func exitCmd(args []string, out io.Writer) error {
 	if len(args) == 0 {
-		return "", errors.New("please provide a status code for the exit command")
+		return errors.New("please provide a status code for the exit command")
 	}
 
 	if len(args) > 1 {
-		return "", errors.New("too many argument provided for the exit command")
+		return errors.New("too many argument provided for the exit command")
 	}
 
 	code, err := strconv.Atoi(args[0])
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	os.Exit(code)
-	return "", nil
+	return nil
 }
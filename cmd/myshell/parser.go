@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// parseUserInput tokenizes a raw input line, honoring single/double quotes
+// and backslash escaping the way a POSIX shell would, and additionally
+// splits out `|`, `&&`, `||`, and `;` as standalone operator tokens when
+// they appear outside of quotes. The resulting token stream is handed to
+// parse to build a Sequence.
+func parseUserInput(input string) []string {
+	tokens := []string{}
+	inSingleQuote := false
+	inDoubleQuote := false
+	escaped := false
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+
+		if !inSingleQuote && !inDoubleQuote && !escaped {
+			switch char {
+			case ';':
+				flush()
+				tokens = append(tokens, ";")
+				continue
+			case '|':
+				flush()
+				if i+1 < len(runes) && runes[i+1] == '|' {
+					tokens = append(tokens, "||")
+					i++
+				} else {
+					tokens = append(tokens, "|")
+				}
+				continue
+			case '&':
+				flush()
+				if i+1 < len(runes) && runes[i+1] == '&' {
+					tokens = append(tokens, "&&")
+					i++
+				} else {
+					tokens = append(tokens, "&")
+				}
+				continue
+			}
+		}
+
+		switch char {
+		case '\\':
+			if escaped || inSingleQuote {
+				current.WriteRune(char)
+				escaped = false
+			} else {
+				escaped = true
+			}
+		case '"':
+			if escaped || inSingleQuote {
+				current.WriteRune(char)
+			} else {
+				inDoubleQuote = !inDoubleQuote
+			}
+
+			escaped = false
+		case '\'':
+			if inDoubleQuote && escaped {
+				current.WriteRune('\\')
+			}
+
+			if escaped || inDoubleQuote {
+				current.WriteRune(char)
+			} else {
+				inSingleQuote = !inSingleQuote
+			}
+
+			escaped = false
+		case ' ':
+			if inDoubleQuote && escaped {
+				current.WriteRune('\\')
+			}
+
+			if escaped || inSingleQuote || inDoubleQuote {
+				current.WriteRune(char)
+			} else {
+				flush()
+			}
+
+			escaped = false
+		default:
+			if escaped && inDoubleQuote {
+				current.WriteRune('\\')
+			}
+
+			current.WriteRune(char)
+			escaped = false
+		}
+	}
+
+	flush()
+
+	return tokens
+}
+
+// isSequenceOperator reports whether tok joins two Pipelines in a Sequence.
+// `&` is included: it terminates a pipeline the same way `;` does, but also
+// marks that pipeline to run in the background.
+func isSequenceOperator(tok string) bool {
+	return tok == ";" || tok == "&&" || tok == "||" || tok == "&"
+}
+
+// parse builds a Sequence of Pipelines of Commands out of a token stream
+// produced by parseUserInput.
+func parse(tokens []string) (*Sequence, error) {
+	seq := &Sequence{}
+	var current []string
+
+	for _, tok := range tokens {
+		if isSequenceOperator(tok) {
+			pipeline, err := parsePipeline(current)
+			if err != nil {
+				return nil, err
+			}
+
+			if tok == "&" {
+				pipeline.Background = true
+				tok = ";"
+			}
+
+			seq.Pipelines = append(seq.Pipelines, pipeline)
+			seq.Ops = append(seq.Ops, tok)
+			current = nil
+			continue
+		}
+
+		current = append(current, tok)
+	}
+
+	if len(current) > 0 {
+		pipeline, err := parsePipeline(current)
+		if err != nil {
+			return nil, err
+		}
+
+		seq.Pipelines = append(seq.Pipelines, pipeline)
+	}
+
+	if len(seq.Pipelines) == 0 {
+		return nil, errors.New("please provide a command")
+	}
+
+	return seq, nil
+}
+
+// parsePipeline splits tokens on `|` into stages and parses each stage into
+// a Command.
+func parsePipeline(tokens []string) (*Pipeline, error) {
+	pipeline := &Pipeline{}
+
+	for _, stageTokens := range splitTokens(tokens, "|") {
+		cmd, err := parseCommand(stageTokens)
+		if err != nil {
+			return nil, err
+		}
+
+		pipeline.Stages = append(pipeline.Stages, cmd)
+	}
+
+	return pipeline, nil
+}
+
+// parseCommand pulls any redirections out of a single stage's tokens and
+// returns the remaining name/args as a Command.
+func parseCommand(tokens []string) (*Command, error) {
+	var args []string
+	var redirects []Redirect
+
+	for i := 0; i < len(tokens); i++ {
+		if isRedirectOperator(tokens[i]) {
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("expected file path after %s", tokens[i])
+			}
+
+			redirects = append(redirects, Redirect{Op: tokens[i], Path: tokens[i+1]})
+			i++
+			continue
+		}
+
+		args = append(args, tokens[i])
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("please provide a command")
+	}
+
+	return &Command{Name: args[0], Args: args[1:], Redirects: redirects}, nil
+}
+
+// splitTokens splits tokens on every occurrence of sep, the way
+// strings.Split works on a string.
+func splitTokens(tokens []string, sep string) [][]string {
+	groups := [][]string{{}}
+
+	for _, tok := range tokens {
+		if tok == sep {
+			groups = append(groups, []string{})
+			continue
+		}
+
+		last := len(groups) - 1
+		groups[last] = append(groups[last], tok)
+	}
+
+	return groups
+}